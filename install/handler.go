@@ -0,0 +1,50 @@
+package install
+
+import (
+	"encoding/json"
+	log "github.com/Sirupsen/logrus"
+	"net/http"
+)
+
+// PlannedPackage is the JSON-facing view of a resolved packageDefinition in
+// an install plan.
+type PlannedPackage struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+func (d *packageDefinition) planned() PlannedPackage {
+	return PlannedPackage{Name: d.name, Version: d.version}
+}
+
+// PlanHandler implements POST /packages/<name>/plan: it decodes a
+// PackageRequest body, resolves the install plan via Install.Plan, and
+// writes it back as JSON without installing anything. This tree has no
+// router wired up yet, so mounting the path and populating Name from the
+// URL is left to whatever mux the server package ends up using.
+func PlanHandler(install *Install) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		request := &PackageRequest{}
+		if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		plan, err := install.Plan(request)
+		if err != nil {
+			log.Errorf("Could not plan install of %s: %v", request.Name, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		planned := make([]PlannedPackage, len(plan))
+		for i, pkgDef := range plan {
+			planned[i] = pkgDef.planned()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(planned); err != nil {
+			log.Errorf("Could not encode install plan for %s: %v", request.Name, err)
+		}
+	}
+}
@@ -2,15 +2,21 @@ package install
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
+	"github.com/Masterminds/semver"
 	log "github.com/Sirupsen/logrus"
+	consul "github.com/hashicorp/consul/api"
+	"github.com/ericsakowski/mantl-api/repository"
 	"github.com/hoisie/mustache"
 	"path"
 	"sort"
 	"strings"
 )
 
+// InstallStateRoot is the Consul prefix under which per-package install
+// state (such as the last successfully installed version) is recorded.
+const InstallStateRoot = "mantl-install/state"
+
 type PackageVersion struct {
 	Version   string `json:"version"`
 	Index     string `json:"index"`
@@ -19,15 +25,121 @@ type PackageVersion struct {
 
 type packageVersionByMostRecent []*PackageVersion
 
-func (p packageVersionByMostRecent) Len() int           { return len(p) }
-func (p packageVersionByMostRecent) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
-func (p packageVersionByMostRecent) Less(i, j int) bool { return p[j].Index < p[i].Index }
+func (p packageVersionByMostRecent) Len() int      { return len(p) }
+func (p packageVersionByMostRecent) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+
+// Less orders by parsed semver of Version when both sides parse cleanly,
+// falling back to the original Index-based ordering otherwise.
+func (p packageVersionByMostRecent) Less(i, j int) bool {
+	vi, ei := semver.NewVersion(p[i].Version)
+	vj, ej := semver.NewVersion(p[j].Version)
+	if ei == nil && ej == nil {
+		return vi.GreaterThan(vj)
+	}
+	return p[j].Index < p[i].Index
+}
+
+// NoMatchingVersionError is returned when a version query does not resolve
+// to any known, supported version of a package.
+type NoMatchingVersionError struct {
+	Package    string
+	Query      string
+	Candidates []string
+}
+
+func (e *NoMatchingVersionError) Error() string {
+	return fmt.Sprintf(
+		"no version of %s matching %q found (candidates: %s)",
+		e.Package, e.Query, strings.Join(e.Candidates, ", "),
+	)
+}
+
+// DowngradeError is returned when a PackageRequest resolves to a version
+// lower than the recorded installed version and the request's
+// UpgradeConstraintPolicy does not allow downgrades.
+type DowngradeError struct {
+	Package   string
+	Installed string
+	Requested string
+}
+
+func (e *DowngradeError) Error() string {
+	return fmt.Sprintf(
+		"%s is installed at %s; %s is a downgrade and UpgradeConstraintPolicy does not allow it",
+		e.Package, e.Installed, e.Requested,
+	)
+}
+
+// PackageNotFoundError is returned when a PackageRequest names a package
+// that doesn't exist, either directly or as a Provides alias.
+type PackageNotFoundError struct {
+	Name string
+}
+
+func (e *PackageNotFoundError) Error() string {
+	return fmt.Sprintf("no package named %q was found", e.Name)
+}
+
+// MultipleProvidersError is returned when a virtual package name is
+// advertised by more than one concrete package and no operator preference
+// resolves the ambiguity.
+type MultipleProvidersError struct {
+	Virtual    string
+	Candidates []string
+}
+
+func (e *MultipleProvidersError) Error() string {
+	return fmt.Sprintf(
+		"multiple packages provide %q: %s (set a preference at %s)",
+		e.Virtual, strings.Join(e.Candidates, ", "), providesPreferenceKey(e.Virtual),
+	)
+}
+
+// ProvidesConfigRoot holds operator-configured preferences for virtual
+// package names, one key per virtual name holding the preferred concrete
+// package name, e.g. mantl-install/config/provides/zk-quorum -> "zookeeper".
+const ProvidesConfigRoot = "mantl-install/config/provides"
+
+func providesPreferenceKey(virtual string) string {
+	return path.Join(ProvidesConfigRoot, virtual)
+}
+
+// UpgradeConstraintPolicy values for PackageRequest.UpgradeConstraintPolicy.
+const (
+	// UpgradeConstraintCatchAll rejects any candidate version lower than the
+	// currently installed version. This is the default when the field is
+	// left blank.
+	UpgradeConstraintCatchAll = "CatchAll"
+	// UpgradeConstraintIgnore allows installing or switching to any version,
+	// including a downgrade from the currently installed version.
+	UpgradeConstraintIgnore = "Ignore"
+)
 
 type PackageRequest struct {
-	Name             string                 `json:"name"`
-	Version          string                 `json:"version"`
-	Config           map[string]interface{} `json:"config"`
-	UninstallOptions map[string]interface{} `json:"uninstallOptions"`
+	Name                    string                 `json:"name"`
+	Version                 string                 `json:"version"`
+	Config                  map[string]interface{} `json:"config"`
+	UninstallOptions        map[string]interface{} `json:"uninstallOptions"`
+	UpgradeConstraintPolicy string                 `json:"upgradeConstraintPolicy"`
+}
+
+// downgradeBlocked reports whether this request's policy forbids moving to
+// candidate given the package's currently installed version.
+func (r PackageRequest) downgradeBlocked(installed, candidate string) (bool, error) {
+	if r.UpgradeConstraintPolicy == UpgradeConstraintIgnore {
+		return false, nil
+	}
+
+	installedVersion, err := semver.NewVersion(installed)
+	if err != nil {
+		return false, err
+	}
+	candidateVersion, err := semver.NewVersion(candidate)
+	if err != nil {
+		return false, err
+	}
+
+	return candidateVersion.LessThan(installedVersion), nil
 }
 
 func NewPackageRequest(data []byte) (*PackageRequest, error) {
@@ -44,6 +156,15 @@ type Package struct {
 	Supported      bool                       `json:"supported"`
 	Tags           []string                   `json:"tags"`
 	Versions       map[string]*PackageVersion `json:"versions"`
+	// Provides lists virtual capabilities (e.g. "mesos-framework-scheduler")
+	// this package advertises in addition to its concrete Name, sourced from
+	// its current version's package.json.
+	Provides []string `json:"provides"`
+	// Dependencies lists the other packages (or provides aliases) this
+	// package's current version requires, sourced from its
+	// dependencies.json. See Resolver for how these are turned into an
+	// install plan.
+	Dependencies []PackageDependency `json:"dependencies"`
 }
 
 func (p Package) ContainerId() string {
@@ -86,15 +207,102 @@ func (p Package) HasSupportedVersion() bool {
 	return len(p.SupportedVersions()) > 0
 }
 
-func (p Package) FindPackageVersion(version string) *PackageVersion {
-	for _, v := range p.PackageVersions() {
-		if strings.EqualFold(v.Version, strings.TrimSpace(version)) {
-			return v
+// FindPackageVersion resolves a version query against the package's
+// supported versions. Recognized query forms are "latest"/"upgrade" or an
+// empty string (the most recent supported version), "patch" (the highest
+// version sharing MAJOR.MINOR with p.CurrentVersion; the installed version
+// recorded under InstallStateRoot is not consulted), a semver range
+// constraint such as ">=2.1.0, <3.0.0", or an exact pin prefixed with "=".
+// A bare version such as "1.2.3" also parses as a semver constraint and is
+// matched through it; only a query that is not a valid constraint is
+// matched literally against Version. It returns a *NoMatchingVersionError
+// when nothing satisfies the query.
+func (p Package) FindPackageVersion(query string) (*PackageVersion, error) {
+	query = strings.TrimSpace(query)
+
+	switch strings.ToLower(query) {
+	case "", "latest", "upgrade":
+		if v := p.findLatestSupportedVersion(); v != nil {
+			return v, nil
+		}
+		return nil, p.noMatchingVersionError(query)
+	case "patch":
+		current := p.Versions[p.CurrentVersion]
+		if current == nil {
+			return nil, p.noMatchingVersionError(query)
+		}
+		currentVersion, err := semver.NewVersion(current.Version)
+		if err != nil {
+			return nil, err
+		}
+		return p.findHighestSatisfying(query, func(v *semver.Version) bool {
+			return v.Major() == currentVersion.Major() && v.Minor() == currentVersion.Minor()
+		})
+	}
+
+	if strings.HasPrefix(query, "=") {
+		pin := strings.TrimSpace(strings.TrimPrefix(query, "="))
+		for _, v := range p.SupportedVersions() {
+			if strings.EqualFold(v.Version, pin) {
+				return v, nil
+			}
+		}
+		return nil, p.noMatchingVersionError(query)
+	}
+
+	if constraint, err := semver.NewConstraint(query); err == nil {
+		return p.findHighestSatisfying(query, constraint.Check)
+	}
+
+	for _, v := range p.SupportedVersions() {
+		if strings.EqualFold(v.Version, query) {
+			return v, nil
 		}
 	}
+	return nil, p.noMatchingVersionError(query)
+}
+
+// findLatestSupportedVersion returns the most recent version among
+// p.SupportedVersions(), using the same semver-aware ordering as
+// FindLatestPackageVersion.
+func (p Package) findLatestSupportedVersion() *PackageVersion {
+	versions := p.SupportedVersions()
+	sort.Sort(packageVersionByMostRecent(versions))
+	if len(versions) > 0 {
+		return versions[0]
+	}
 	return nil
 }
 
+func (p Package) findHighestSatisfying(query string, match func(*semver.Version) bool) (*PackageVersion, error) {
+	var best *PackageVersion
+	var bestVersion *semver.Version
+
+	for _, v := range p.SupportedVersions() {
+		parsed, err := semver.NewVersion(v.Version)
+		if err != nil || !match(parsed) {
+			continue
+		}
+		if best == nil || parsed.GreaterThan(bestVersion) {
+			best = v
+			bestVersion = parsed
+		}
+	}
+
+	if best == nil {
+		return nil, p.noMatchingVersionError(query)
+	}
+	return best, nil
+}
+
+func (p Package) noMatchingVersionError(query string) *NoMatchingVersionError {
+	var candidates []string
+	for _, v := range p.SupportedVersions() {
+		candidates = append(candidates, v.Version)
+	}
+	return &NoMatchingVersionError{Package: p.Name, Query: query, Candidates: candidates}
+}
+
 func (p Package) FindLatestPackageVersion() *PackageVersion {
 	versions := p.PackageVersions()
 	sort.Sort(packageVersionByMostRecent(versions))
@@ -258,12 +466,71 @@ func (install *Install) getPackages() (PackageCollection, error) {
 		pkg := entry.ToPackage()
 		install.setSupportedVersions(pkg)
 		install.setCurrentVersion(pkg)
+		install.setProvides(pkg)
+		install.setDependencies(pkg)
 		packages[i] = pkg
 	}
 
 	return packages, nil
 }
 
+// setProvides populates pkg.Provides from the package.json of its current
+// (or, absent that, latest) version.
+func (install *Install) setProvides(pkg *Package) {
+	version := pkg.Versions[pkg.CurrentVersion]
+	if version == nil {
+		version = pkg.FindLatestPackageVersion()
+	}
+	if version == nil {
+		return
+	}
+
+	repositories, err := install.Repositories()
+	if err != nil {
+		log.Errorf("Could not read repositories to determine provides for %s: %v", pkg.Name, err)
+		return
+	}
+
+	var data []byte
+	for _, repo := range repositoriesByPrecedence(repositories, install.activeChannelsOrAll()...) {
+		pkgKey := path.Join(repo.PackagesKey(), pkg.PackageVersionKey(version.Index))
+		if d := install.getPackageDefinitionFile("package.json", pkgKey); len(d) > 0 {
+			data = d
+		}
+	}
+	if len(data) == 0 {
+		return
+	}
+
+	var meta struct {
+		Provides []string `json:"provides"`
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		log.Warnf("Could not unmarshal package.json for %s: %v", pkg.Name, err)
+		return
+	}
+	pkg.Provides = meta.Provides
+}
+
+// setDependencies populates pkg.Dependencies from the dependencies.json of
+// its current (or, absent that, latest) version.
+func (install *Install) setDependencies(pkg *Package) {
+	version := pkg.Versions[pkg.CurrentVersion]
+	if version == nil {
+		version = pkg.FindLatestPackageVersion()
+	}
+	if version == nil {
+		return
+	}
+
+	deps, err := install.getPackageDependencies(pkg, version)
+	if err != nil {
+		log.Warnf("Could not read dependencies for %s: %v", pkg.Name, err)
+		return
+	}
+	pkg.Dependencies = deps
+}
+
 func (install *Install) getPackageByName(name string) (*Package, error) {
 	packages, err := install.getPackages()
 
@@ -278,22 +545,127 @@ func (install *Install) getPackageByName(name string) (*Package, error) {
 		}
 	}
 
-	return nil, nil
+	return install.getPackageByProvides(packages, n)
 }
 
-func (install *Install) GetPackageDefinition(name string, version string) (*packageDefinition, error) {
-	pkg, err := install.getPackageByName(name)
+// getPackageByProvides resolves a virtual package name against every
+// package's advertised Provides. When more than one package provides the
+// same virtual name, an operator-configured preference at
+// providesPreferenceKey(virtual) breaks the tie; otherwise it returns a
+// *MultipleProvidersError so the caller can disambiguate.
+func (install *Install) getPackageByProvides(packages PackageCollection, virtual string) (*Package, error) {
+	var providers PackageCollection
+	for _, p := range packages {
+		for _, provided := range p.Provides {
+			if strings.EqualFold(provided, virtual) {
+				providers = append(providers, p)
+				break
+			}
+		}
+	}
+
+	switch len(providers) {
+	case 0:
+		return nil, nil
+	case 1:
+		return providers[0], nil
+	}
+
+	preferred, err := install.providesPreference(virtual)
 	if err != nil {
 		return nil, err
 	}
+	if preferred != "" {
+		for _, p := range providers {
+			if strings.EqualFold(p.Name, preferred) {
+				return p, nil
+			}
+		}
+	}
+
+	var candidates []string
+	for _, p := range providers {
+		candidates = append(candidates, p.Name)
+	}
+	sort.Strings(candidates)
+	return nil, &MultipleProvidersError{Virtual: virtual, Candidates: candidates}
+}
+
+func (install *Install) providesPreference(virtual string) (string, error) {
+	kp, _, err := install.kv.Get(providesPreferenceKey(virtual), nil)
+	if err != nil {
+		log.Errorf("Could not read provides preference for %s: %v", virtual, err)
+		return "", err
+	}
+	if kp == nil {
+		return "", nil
+	}
+	return string(kp.Value), nil
+}
+
+// installedVersionKey is the Consul key holding the last version of name
+// successfully installed, e.g. mantl-install/state/cassandra/version.
+func installedVersionKey(name string) string {
+	return path.Join(InstallStateRoot, name, "version")
+}
+
+func (install *Install) getInstalledVersion(name string) (string, error) {
+	kp, _, err := install.kv.Get(installedVersionKey(name), nil)
+	if err != nil {
+		log.Errorf("Could not read installed version for %s: %v", name, err)
+		return "", err
+	}
+	if kp == nil {
+		return "", nil
+	}
+	return string(kp.Value), nil
+}
 
-	pkgVersion := pkg.FindPackageVersion(version)
-	if pkgVersion == nil {
-		pkgVersion = pkg.FindLatestPackageVersion()
+// RecordInstalledVersion persists version as the last successfully
+// installed version of name. The Marathon deploy workflow should call this
+// once the app has been accepted so future installs/upgrades are checked
+// against it.
+func (install *Install) RecordInstalledVersion(name string, version string) error {
+	_, err := install.kv.Put(&consul.KVPair{
+		Key:   installedVersionKey(name),
+		Value: []byte(version),
+	}, nil)
+	if err != nil {
+		log.Errorf("Could not record installed version for %s: %v", name, err)
 	}
+	return err
+}
 
-	if pkgVersion == nil {
-		return nil, errors.New(fmt.Sprintf("Could not find installable version for %s", name))
+func (install *Install) GetPackageDefinition(request *PackageRequest) (*packageDefinition, error) {
+	pkg, err := install.getPackageByName(request.Name)
+	if err != nil {
+		return nil, err
+	}
+	if pkg == nil {
+		return nil, &PackageNotFoundError{Name: request.Name}
+	}
+
+	pkgVersion, err := pkg.FindPackageVersion(request.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	installedVersion, err := install.getInstalledVersion(pkg.Name)
+	if err != nil {
+		return nil, err
+	}
+	if installedVersion != "" {
+		blocked, err := request.downgradeBlocked(installedVersion, pkgVersion.Version)
+		if err != nil {
+			return nil, err
+		}
+		if blocked {
+			return nil, &DowngradeError{
+				Package:   pkg.Name,
+				Installed: installedVersion,
+				Requested: pkgVersion.Version,
+			}
+		}
 	}
 
 	repositories, err := install.Repositories()
@@ -308,7 +680,7 @@ func (install *Install) GetPackageDefinition(name string, version string) (*pack
 		framework: pkg.Framework,
 	}
 
-	for _, repo := range repositories {
+	for _, repo := range repositoriesByPrecedence(repositories, install.activeChannelsOrAll()...) {
 		pkgKey := path.Join(
 			repo.PackagesKey(),
 			pkg.PackageVersionKey(pkgVersion.Index),
@@ -351,6 +723,38 @@ func (install *Install) GetPackageDefinition(name string, version string) (*pack
 	return pkgDef, nil
 }
 
+// repositoriesByPrecedence orders repositories so that, when a package file
+// is read from more than one of them, the one applied last wins: the base
+// repository first, then layers from lowest to highest Priority. This makes
+// a higher-Priority layer's copy win over both the base repository's and a
+// lower-Priority layer's, per Repository.Priority. When channels is
+// non-empty, layers outside it are excluded, matching the filtering
+// setSupportedVersions already applies - so file precedence and
+// support-filtering always agree on which layers are in scope.
+func repositoriesByPrecedence(repositories repository.RepositoryCollection, channels ...string) repository.RepositoryCollection {
+	var ordered repository.RepositoryCollection
+	if base := repositories.Base(); base != nil {
+		ordered = append(ordered, base)
+	}
+
+	layers := repositories.Layers(channels...) // highest Priority first
+	for i := len(layers) - 1; i >= 0; i-- {
+		ordered = append(ordered, layers[i])
+	}
+	return ordered
+}
+
+// activeChannelsOrAll returns the cluster's active channels, or nil (meaning
+// "all channels") if they can't be determined.
+func (install *Install) activeChannelsOrAll() []string {
+	channels, err := install.activeChannels()
+	if err != nil {
+		log.Warnf("Could not read active channels, consulting all layers: %v", err)
+		return nil
+	}
+	return channels
+}
+
 func (install *Install) getPackageDefinitionFile(name string, key string) []byte {
 	kp, _, err := install.kv.Get(path.Join(key, name), nil)
 	if err != nil {
@@ -365,6 +769,29 @@ func (install *Install) getPackageDefinitionFile(name string, key string) []byte
 	return []byte{}
 }
 
+// ActiveChannelsKey holds a comma-separated list of repository channels
+// (e.g. "stable" or "stable,beta") this cluster is subscribed to. When
+// unset, layers in any channel are consulted.
+const ActiveChannelsKey = "mantl-install/config/channels"
+
+func (install *Install) activeChannels() ([]string, error) {
+	kp, _, err := install.kv.Get(ActiveChannelsKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	if kp == nil || len(kp.Value) == 0 {
+		return nil, nil
+	}
+
+	var channels []string
+	for _, c := range strings.Split(string(kp.Value), ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			channels = append(channels, c)
+		}
+	}
+	return channels, nil
+}
+
 func (install *Install) setSupportedVersions(pkg *Package) {
 	layers, err := install.LayerRepositories()
 	if err != nil {
@@ -372,7 +799,18 @@ func (install *Install) setSupportedVersions(pkg *Package) {
 		return
 	}
 
+	channels, err := install.activeChannels()
+	if err != nil {
+		log.Warnf("Could not read active channels, consulting all layers: %v", err)
+	} else if len(channels) > 0 {
+		layers = layers.Layers(channels...)
+	}
+
 	for version, pkgVersion := range pkg.Versions {
+		var min, max *semver.Version
+		excluded := make(map[string]bool)
+		present := false
+
 		for _, layer := range layers {
 			versionKey := path.Join(
 				layer.PackagesKey(),
@@ -383,16 +821,88 @@ func (install *Install) setSupportedVersions(pkg *Package) {
 			kp, _, err := install.kv.Get(versionKey, nil)
 			if err != nil {
 				log.Warnf("Could not read %s: %v", versionKey, err)
+				continue
+			}
+			if kp == nil {
+				continue
+			}
+			present = true
+
+			// an empty body is the legacy mere-presence marker: supported,
+			// with no extra min/max/excluded constraints
+			if len(kp.Value) == 0 {
+				continue
+			}
+
+			var constraint layerVersionConstraint
+			if err := json.Unmarshal(kp.Value, &constraint); err != nil {
+				log.Warnf("Could not parse constraint at %s, treating as unconstrained: %v", versionKey, err)
+				continue
 			}
 
-			pkgVersion.Supported = kp != nil
-			pkg.Versions[version] = pkgVersion
+			if constraint.Min != "" {
+				if v, err := semver.NewVersion(constraint.Min); err == nil {
+					if min == nil || v.GreaterThan(min) {
+						min = v
+					}
+				} else {
+					log.Warnf("Invalid min constraint %q at %s: %v", constraint.Min, versionKey, err)
+				}
+			}
+			if constraint.Max != "" {
+				if v, err := semver.NewVersion(constraint.Max); err == nil {
+					if max == nil || v.LessThan(max) {
+						max = v
+					}
+				} else {
+					log.Warnf("Invalid max constraint %q at %s: %v", constraint.Max, versionKey, err)
+				}
+			}
+			for _, ex := range constraint.Excluded {
+				excluded[ex] = true
+			}
+		}
+
+		pkgVersion.Supported = present
+		if present {
+			target, err := semver.NewVersion(pkgVersion.Version)
+			if err != nil {
+				log.Warnf("Could not parse version %s for %s, leaving supported as-is: %v", pkgVersion.Version, pkg.Name, err)
+			} else {
+				if min != nil && target.LessThan(min) {
+					log.Warnf("%s excluded: %s is below the aggregated minimum %s", pkg.PackageVersionKey(pkgVersion.Index), pkgVersion.Version, min.String())
+					pkgVersion.Supported = false
+				}
+				if pkgVersion.Supported && max != nil && target.GreaterThan(max) {
+					log.Warnf("%s excluded: %s is above the aggregated maximum %s", pkg.PackageVersionKey(pkgVersion.Index), pkgVersion.Version, max.String())
+					pkgVersion.Supported = false
+				}
+				if pkgVersion.Supported {
+					for ex := range excluded {
+						if strings.EqualFold(ex, pkgVersion.Version) {
+							log.Warnf("%s excluded: %s is on the excluded list", pkg.PackageVersionKey(pkgVersion.Index), pkgVersion.Version)
+							pkgVersion.Supported = false
+							break
+						}
+					}
+				}
+			}
 		}
+
+		pkg.Versions[version] = pkgVersion
 	}
 
 	pkg.Supported = pkg.HasSupportedVersion()
 }
 
+// layerVersionConstraint is the shape of a layer's mantl.json overlay for a
+// given package version, e.g. {"min":"1.4.0","max":"2.0.0","excluded":["1.5.2"]}.
+type layerVersionConstraint struct {
+	Min      string   `json:"min"`
+	Max      string   `json:"max"`
+	Excluded []string `json:"excluded"`
+}
+
 func (install *Install) setCurrentVersion(pkg *Package) {
 	if !pkg.Supported || !pkg.HasSupportedVersion() {
 		// we don't support any version so defer to the base package
@@ -406,14 +916,27 @@ func (install *Install) setCurrentVersion(pkg *Package) {
 		}
 	}
 
-	// CurrentVersion is not supported so we want to set it to the highest supported version
+	installedVersion, err := install.getInstalledVersion(pkg.Name)
+	if err != nil {
+		log.Warnf("Could not read installed version for %s, not filtering downgrades: %v", pkg.Name, err)
+		installedVersion = ""
+	}
+
+	// CurrentVersion is not supported so we want to set it to the highest
+	// supported version that isn't a downgrade from what's installed.
 	versions := pkg.SupportedVersions()
 	sort.Sort(packageVersionByMostRecent(versions))
 	for _, pv := range versions {
-		if pv.Supported {
-			pkg.CurrentVersion = pv.Version
-			break
+		if !pv.Supported {
+			continue
+		}
+		if installedVersion != "" {
+			if blocked, err := (PackageRequest{}).downgradeBlocked(installedVersion, pv.Version); err == nil && blocked {
+				continue
+			}
 		}
+		pkg.CurrentVersion = pv.Version
+		break
 	}
 }
 
@@ -0,0 +1,263 @@
+package install
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/Masterminds/semver"
+	"path"
+	"strings"
+)
+
+// PackageDependency is a single entry in a package version's
+// dependencies.json, naming another package and the semver range it
+// requires.
+type PackageDependency struct {
+	Name  string `json:"name"`
+	Range string `json:"range"`
+}
+
+// DependencyCycleError is returned when the dependency graph rooted at the
+// requested package contains a cycle.
+type DependencyCycleError struct {
+	Path []string
+}
+
+func (e *DependencyCycleError) Error() string {
+	return fmt.Sprintf("dependency cycle detected: %s", strings.Join(e.Path, " -> "))
+}
+
+// DependencyConflictError is returned when the recorded requirements for a
+// package have disjoint ranges, so no single selected version can satisfy
+// all of them.
+type DependencyConflictError struct {
+	Package     string
+	Constraints []string
+}
+
+func (e *DependencyConflictError) Error() string {
+	return fmt.Sprintf("conflicting requirements for %s: %s", e.Package, strings.Join(e.Constraints, ", "))
+}
+
+// Resolver computes an ordered install plan for a PackageRequest and its
+// transitive dependencies. Each requirement picks the highest supported
+// version its query allows (Package.FindPackageVersion), and the selected
+// version of every reachable package is the highest of those picks; the
+// lowest version a range allows is not what gets selected. A dependency may
+// name either a concrete package or a Provides virtual alias; visit
+// resolves every name to its concrete Package.Name via getPackageByName
+// before tracking it, so two requirements that reach the same package
+// through different aliases are treated as one graph node.
+type Resolver struct {
+	install *Install
+}
+
+func NewResolver(install *Install) *Resolver {
+	return &Resolver{install: install}
+}
+
+// Plan builds a topologically-ordered install plan for req and its
+// transitive dependencies, without installing anything.
+func (r *Resolver) Plan(req *PackageRequest) ([]*packageDefinition, error) {
+	selected := make(map[string]*semver.Version)
+	constraints := make(map[string][]string)
+	var order []string
+
+	// visit is keyed on name, which may be either a concrete package name or
+	// a virtual provides alias. It resolves name to its concrete pkg.Name up
+	// front and uses that as the graph node everywhere below, so two
+	// requirements naming the same concrete package through different
+	// aliases collapse onto one node instead of being tracked (and
+	// installed) as independent packages.
+	var visit func(name, versionQuery string, path []string) error
+	visit = func(name, versionQuery string, path []string) error {
+		pkg, err := r.install.getPackageByName(name)
+		if err != nil {
+			return err
+		}
+		if pkg == nil {
+			return &PackageNotFoundError{Name: name}
+		}
+		canonical := pkg.Name
+
+		for _, ancestor := range path {
+			if ancestor == canonical {
+				return &DependencyCycleError{Path: append(append([]string{}, path...), canonical)}
+			}
+		}
+
+		pkgVersion, err := pkg.FindPackageVersion(versionQuery)
+		if err != nil {
+			return err
+		}
+
+		candidate, err := semver.NewVersion(pkgVersion.Version)
+		if err != nil {
+			return err
+		}
+
+		constraints[canonical] = append(constraints[canonical], versionQuery)
+		if existing, ok := selected[canonical]; !ok || candidate.GreaterThan(existing) {
+			selected[canonical] = candidate
+		}
+		if !containsString(order, canonical) {
+			order = append(order, canonical)
+		}
+
+		deps, err := r.install.getPackageDependencies(pkg, pkgVersion)
+		if err != nil {
+			return err
+		}
+
+		childPath := append(path, canonical)
+		for _, dep := range deps {
+			if err := visit(dep.Name, dep.Range, childPath); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := visit(req.Name, req.Version, nil); err != nil {
+		return nil, err
+	}
+
+	// Phase 1 above walks whichever version satisfies each individual
+	// requirement, not necessarily the version MVS ends up selecting for
+	// that package - a package reached first through a narrow range and
+	// later bumped higher by a looser one never has the higher version's
+	// own dependencies.json consulted. Re-derive dependencies from each
+	// package's current selected version and fold any newly-discovered (or
+	// newly-raised) requirements back in, until selection stops changing.
+	for changed := true; changed; {
+		changed = false
+		for _, name := range append([]string{}, order...) {
+			pkg, err := r.install.getPackageByName(name)
+			if err != nil {
+				return nil, err
+			}
+
+			pkgVersion, err := pkg.FindPackageVersion(fmt.Sprintf("=%s", selected[name].String()))
+			if err != nil {
+				return nil, err
+			}
+
+			deps, err := r.install.getPackageDependencies(pkg, pkgVersion)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, dep := range deps {
+				depPkg, err := r.install.getPackageByName(dep.Name)
+				if err != nil {
+					return nil, err
+				}
+				if depPkg == nil {
+					return nil, &PackageNotFoundError{Name: dep.Name}
+				}
+				canonical := depPkg.Name
+
+				depVersion, err := depPkg.FindPackageVersion(dep.Range)
+				if err != nil {
+					return nil, err
+				}
+				candidate, err := semver.NewVersion(depVersion.Version)
+				if err != nil {
+					return nil, err
+				}
+
+				constraints[canonical] = append(constraints[canonical], dep.Range)
+				if existing, ok := selected[canonical]; !ok || candidate.GreaterThan(existing) {
+					selected[canonical] = candidate
+					changed = true
+				}
+				if !containsString(order, canonical) {
+					order = append(order, canonical)
+					changed = true
+				}
+			}
+		}
+	}
+
+	for name, version := range selected {
+		for _, c := range constraints[name] {
+			constraint, err := semver.NewConstraint(c)
+			if err != nil {
+				// not a semver constraint (e.g. "latest", "patch") - already
+				// accounted for when the candidate was selected
+				continue
+			}
+			if !constraint.Check(version) {
+				return nil, &DependencyConflictError{Package: name, Constraints: constraints[name]}
+			}
+		}
+	}
+
+	var plan []*packageDefinition
+	seen := make(map[string]bool)
+	for _, name := range order {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		pkgDef, err := r.install.GetPackageDefinition(&PackageRequest{
+			Name:    name,
+			Version: fmt.Sprintf("=%s", selected[name].String()),
+		})
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, pkgDef)
+	}
+
+	return plan, nil
+}
+
+// Plan is a convenience wrapper around Resolver.Plan so callers don't need
+// to construct a Resolver themselves.
+func (install *Install) Plan(req *PackageRequest) ([]*packageDefinition, error) {
+	return NewResolver(install).Plan(req)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// getPackageDependencies reads dependencies.json for pkgVersion across all
+// repository layers, with later layers in the same precedence order as
+// GetPackageDefinition taking priority over earlier ones.
+func (install *Install) getPackageDependencies(pkg *Package, pkgVersion *PackageVersion) ([]PackageDependency, error) {
+	repositories, err := install.Repositories()
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	for _, repo := range repositoriesByPrecedence(repositories, install.activeChannelsOrAll()...) {
+		pkgKey := path.Join(
+			repo.PackagesKey(),
+			pkg.PackageVersionKey(pkgVersion.Index),
+		)
+		if d := install.getPackageDefinitionFile("dependencies.json", pkgKey); len(d) > 0 {
+			data = d
+		}
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var deps []PackageDependency
+	if err := json.Unmarshal(data, &deps); err != nil {
+		log.Errorf("Could not unmarshal dependencies.json for %s: %v", pkg.Name, err)
+		return nil, err
+	}
+	return deps, nil
+}
@@ -0,0 +1,254 @@
+package repository
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	consul "github.com/hashicorp/consul/api"
+	"golang.org/x/crypto/ed25519"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// DefaultFetchInterval is how often a Fetcher polls remote index.json
+// manifests when none is configured.
+const DefaultFetchInterval = 5 * time.Minute
+
+// packageFiles are the per-version files that GetPackageDefinition and
+// friends read out of Consul under PackagesKey()/<package>/<version index>/.
+var packageFiles = []string{
+	"package.json",
+	"command.json",
+	"config.json",
+	"marathon.json",
+	"mantl.json",
+	"dependencies.json",
+}
+
+// remotePackageIndex mirrors just enough of install.packageIndex to let the
+// fetcher walk a remote repository's package tree without importing the
+// install package.
+type remotePackageIndex struct {
+	Packages []remotePackageIndexEntry
+}
+
+type remotePackageIndexEntry struct {
+	Name     string
+	Versions map[string]string
+}
+
+// Fetcher periodically pulls the remote index.json for repository layers
+// that aren't natively maintained in Consul, verifies its ed25519 signature
+// against the layer's stored pubkey, and syncs both the index and the
+// package tree it describes into Consul under the same key layout
+// Repositories() and GetPackageDefinition read from.
+type Fetcher struct {
+	client   *consul.Client
+	http     *http.Client
+	Interval time.Duration
+}
+
+func NewFetcher(client *consul.Client) *Fetcher {
+	return &Fetcher{
+		client:   client,
+		http:     &http.Client{Timeout: 30 * time.Second},
+		Interval: DefaultFetchInterval,
+	}
+}
+
+// Run polls every repository layer with a configured remote URL on
+// f.Interval until stop is closed. It syncs once immediately before
+// entering the poll loop.
+func (f *Fetcher) Run(stop <-chan struct{}) {
+	f.SyncAll()
+
+	ticker := time.NewTicker(f.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			f.SyncAll()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// SyncAll fetches every remote-backed repository layer once.
+func (f *Fetcher) SyncAll() {
+	repos, err := Repositories(f.client)
+	if err != nil {
+		log.Errorf("Fetcher could not list repositories: %v", err)
+		return
+	}
+
+	for _, repo := range repos {
+		if err := f.sync(repo); err != nil {
+			log.Errorf("Could not sync repository %d (%s): %v", repo.Index, repo.Name, err)
+		}
+	}
+}
+
+func (f *Fetcher) sync(repo *Repository) error {
+	kv := f.client.KV()
+
+	urlPair, _, err := kv.Get(repo.URLKey(), nil)
+	if err != nil {
+		return err
+	}
+	if urlPair == nil || len(urlPair.Value) == 0 {
+		return nil // Consul-backed layer, nothing to pull
+	}
+	indexURL := string(urlPair.Value)
+
+	index, err := f.fetchIndex(indexURL)
+	if err != nil {
+		return err
+	}
+
+	if err := f.verify(kv, repo, index); err != nil {
+		return err
+	}
+
+	if _, err := kv.Put(&consul.KVPair{Key: repo.PackageIndexKey(), Value: index}, nil); err != nil {
+		return err
+	}
+
+	return f.syncPackages(kv, repo, indexURL, index)
+}
+
+func (f *Fetcher) fetchIndex(url string) ([]byte, error) {
+	resp, err := f.http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: unexpected status %s", url, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// syncPackages fetches each package version's per-file definitions
+// (package.json, command.json, config.json, marathon.json, mantl.json,
+// dependencies.json) from the remote tree alongside the already-verified
+// index, and writes them into Consul under the same
+// PackagesKey()/<package>/<version index>/ layout GetPackageDefinition,
+// setProvides, and getPackageDependencies read from. A file that 404s or is
+// empty for a given version is skipped - not every package ships every
+// file.
+func (f *Fetcher) syncPackages(kv *consul.KV, repo *Repository, indexURL string, index []byte) error {
+	var parsed remotePackageIndex
+	if err := json.Unmarshal(index, &parsed); err != nil {
+		return fmt.Errorf("could not parse package index for repository %d: %v", repo.Index, err)
+	}
+
+	root := packagesRoot(indexURL)
+	for _, pkg := range parsed.Packages {
+		packageKey := path.Join(containerId(pkg.Name), pkg.Name)
+		for _, versionIndex := range pkg.Versions {
+			versionKey := path.Join(packageKey, versionIndex)
+			for _, file := range packageFiles {
+				url := root + "/packages/" + versionKey + "/" + file
+				data, err := f.fetchFile(url)
+				if err != nil {
+					log.Warnf("Could not fetch %s for repository %d: %v", url, repo.Index, err)
+					continue
+				}
+				if len(data) == 0 {
+					continue
+				}
+
+				key := path.Join(repo.PackagesKey(), versionKey, file)
+				if _, err := kv.Put(&consul.KVPair{Key: key, Value: data}, nil); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// fetchFile fetches a single package-tree file, treating a 404 as "this
+// package version doesn't have one" rather than an error.
+func (f *Fetcher) fetchFile(url string) ([]byte, error) {
+	resp, err := f.http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: unexpected status %s", url, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// packagesRoot derives the remote package tree's root from the configured
+// index.json URL by dropping its final path segment, e.g.
+// "https://repo.example.com/meta/index.json" -> "https://repo.example.com/meta".
+func packagesRoot(indexURL string) string {
+	if i := strings.LastIndex(indexURL, "/"); i >= 0 {
+		return indexURL[:i]
+	}
+	return indexURL
+}
+
+// containerId mirrors Package.ContainerId: the package tree is partitioned
+// by the first letter of a package's name.
+func containerId(name string) string {
+	if name == "" {
+		return ""
+	}
+	return strings.ToUpper(string([]rune(name)[0]))
+}
+
+func (f *Fetcher) verify(kv *consul.KV, repo *Repository, index []byte) error {
+	pubKeyPair, _, err := kv.Get(repo.PubKeyKey(), nil)
+	if err != nil {
+		return err
+	}
+	sigPair, _, err := kv.Get(repo.SignatureKey(), nil)
+	if err != nil {
+		return err
+	}
+	if pubKeyPair == nil || sigPair == nil {
+		return fmt.Errorf("repository %d has a remote URL but no pubkey/signature configured", repo.Index)
+	}
+
+	pubKey, err := hex.DecodeString(string(pubKeyPair.Value))
+	if err != nil {
+		return fmt.Errorf("invalid pubkey encoding for repository %d: %v", repo.Index, err)
+	}
+	signature, err := hex.DecodeString(string(sigPair.Value))
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding for repository %d: %v", repo.Index, err)
+	}
+
+	// ed25519.Verify panics rather than erroring on a key of the wrong
+	// length, so a malformed pubkey must be rejected before we ever call it.
+	if len(pubKey) != ed25519.PublicKeySize {
+		return fmt.Errorf(
+			"invalid pubkey for repository %d: expected %d bytes, got %d",
+			repo.Index, ed25519.PublicKeySize, len(pubKey),
+		)
+	}
+
+	if !ed25519.Verify(ed25519.PublicKey(pubKey), index, signature) {
+		return fmt.Errorf("signature verification failed for repository %d index", repo.Index)
+	}
+
+	return nil
+}
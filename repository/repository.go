@@ -12,13 +12,26 @@ import (
 
 const RepositoryRoot = "mantl-install/repository"
 
+// DefaultChannel is the channel assumed for a repository layer that has no
+// "channel" key recorded in Consul, keeping pre-channel deployments working
+// unchanged.
+const DefaultChannel = "stable"
+
 type Repository struct {
-	Name  string
-	Index int
+	Name     string
+	Index    int
+	Channel  string
+	Priority int
 }
 
 type RepositoryCollection []*Repository
 
+type repositoryByPriority RepositoryCollection
+
+func (c repositoryByPriority) Len() int           { return len(c) }
+func (c repositoryByPriority) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c repositoryByPriority) Less(i, j int) bool { return c[i].Priority > c[j].Priority }
+
 func (c RepositoryCollection) Base() *Repository {
 	for _, repo := range c {
 		if repo.Index == 0 {
@@ -28,17 +41,33 @@ func (c RepositoryCollection) Base() *Repository {
 	return nil
 }
 
-func (c RepositoryCollection) Layers() RepositoryCollection {
+// Layers returns the non-base layers, highest Priority first. When one or
+// more channels are given, layers subscribed to a different channel are
+// excluded.
+func (c RepositoryCollection) Layers(channels ...string) RepositoryCollection {
 	var repos RepositoryCollection
 	for _, repo := range c {
 		if repo.IsBase() {
 			continue
 		}
+		if len(channels) > 0 && !repo.inChannels(channels) {
+			continue
+		}
 		repos = append(repos, repo)
 	}
+	sort.Sort(repositoryByPriority(repos))
 	return repos
 }
 
+func (r Repository) inChannels(channels []string) bool {
+	for _, c := range channels {
+		if strings.EqualFold(r.Channel, c) {
+			return true
+		}
+	}
+	return false
+}
+
 func (r Repository) PackageIndexKey() string {
 	return path.Join(
 		RepositoryRoot,
@@ -59,6 +88,21 @@ func (r Repository) IsBase() bool {
 	return r.Index == 0
 }
 
+func (r Repository) PubKeyKey() string {
+	return path.Join(RepositoryRoot, fmt.Sprintf("%d", r.Index), "pubkey")
+}
+
+func (r Repository) SignatureKey() string {
+	return path.Join(RepositoryRoot, fmt.Sprintf("%d", r.Index), "signature")
+}
+
+// URLKey is the Consul key holding the remote index.json URL for a
+// non-Consul-backed repository layer. It is absent for layers whose
+// package tree is maintained directly in Consul.
+func (r Repository) URLKey() string {
+	return path.Join(RepositoryRoot, fmt.Sprintf("%d", r.Index), "url")
+}
+
 func Repositories(client *consul.Client) (RepositoryCollection, error) {
 	idxs, err := indexes(client)
 	if err != nil {
@@ -73,10 +117,14 @@ func Repositories(client *consul.Client) (RepositoryCollection, error) {
 			continue
 		}
 
-		repositories = append(repositories, &Repository{
+		repo := &Repository{
 			Index: idx,
 			Name:  name,
-		})
+		}
+		repo.Channel = channel(client, idx)
+		repo.Priority = priority(client, idx)
+
+		repositories = append(repositories, repo)
 	}
 
 	return repositories, nil
@@ -92,15 +140,22 @@ func BaseRepository(client *consul.Client) (*Repository, error) {
 		return nil, err
 	}
 
-	return &Repository{Name: string(kp.Value), Index: 0}, nil
+	return &Repository{
+		Name:     string(kp.Value),
+		Index:    0,
+		Channel:  channel(client, 0),
+		Priority: priority(client, 0),
+	}, nil
 }
 
-func Layers(client *consul.Client) (RepositoryCollection, error) {
+// Layers returns the non-base repositories, optionally restricted to the
+// given channels (see RepositoryCollection.Layers).
+func Layers(client *consul.Client, channels ...string) (RepositoryCollection, error) {
 	repos, err := Repositories(client)
 	if err != nil {
 		return nil, err
 	}
-	return repos.Layers(), nil
+	return repos.Layers(channels...), nil
 }
 
 func name(client *consul.Client, idx int) (string, error) {
@@ -115,6 +170,42 @@ func name(client *consul.Client, idx int) (string, error) {
 	return string(kp.Value), nil
 }
 
+// channel returns the repository layer's subscribed channel, defaulting to
+// DefaultChannel when unset so pre-channel deployments keep working.
+func channel(client *consul.Client, idx int) string {
+	kv := client.KV()
+	key := path.Join(RepositoryRoot, fmt.Sprintf("%d", idx), "channel")
+	kp, _, err := kv.Get(key, nil)
+	if err != nil {
+		log.Warnf("Could not retrieve channel from %s: %v", key, err)
+	}
+	if kp == nil || len(kp.Value) == 0 {
+		return DefaultChannel
+	}
+	return string(kp.Value)
+}
+
+// priority returns the repository layer's precedence, defaulting to 0.
+// Higher priority layers are preferred when the same package appears in
+// more than one layer.
+func priority(client *consul.Client, idx int) int {
+	kv := client.KV()
+	key := path.Join(RepositoryRoot, fmt.Sprintf("%d", idx), "priority")
+	kp, _, err := kv.Get(key, nil)
+	if err != nil {
+		log.Warnf("Could not retrieve priority from %s: %v", key, err)
+	}
+	if kp == nil || len(kp.Value) == 0 {
+		return 0
+	}
+	p, err := strconv.Atoi(string(kp.Value))
+	if err != nil {
+		log.Warnf("Unexpected priority value at %s: %v", key, err)
+		return 0
+	}
+	return p
+}
+
 func indexes(client *consul.Client) ([]int, error) {
 	kv := client.KV()
 